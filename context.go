@@ -0,0 +1,62 @@
+package filemutex
+
+import (
+	"context"
+	"time"
+)
+
+// acquireMuContext polls mu (the in-process half of the lock) until it is
+// acquired or ctx is done. sync.RWMutex has no native way to wait on a
+// channel, so this is the closest cancellable equivalent.
+func acquireMuContext(ctx context.Context, tryAcquire func() bool) error {
+	backoff := time.Millisecond
+	const maxBackoff = 20 * time.Millisecond
+	for {
+		if tryAcquire() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// LockContext is like Lock, but returns ctx.Err() if ctx is done before the
+// lock is acquired.
+func (m *FileMutex) LockContext(ctx context.Context) error {
+	if err := acquireMuContext(ctx, m.inproc.mu.TryLock); err != nil {
+		return err
+	}
+	if err := m.lockOSContext(ctx); err != nil {
+		m.inproc.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RLockContext is like RLock, but returns ctx.Err() if ctx is done before
+// the lock is acquired.
+func (m *FileMutex) RLockContext(ctx context.Context) error {
+	if err := acquireMuContext(ctx, m.inproc.mu.TryRLock); err != nil {
+		return err
+	}
+	if err := m.rLockOSContext(ctx); err != nil {
+		m.inproc.mu.RUnlock()
+		return err
+	}
+	return nil
+}
+
+// TryLockFor attempts to acquire an exclusive lock, giving up once d has
+// elapsed. It is sugar over LockContext for callers that prefer a duration
+// to a context.
+func (m *FileMutex) TryLockFor(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return m.LockContext(ctx)
+}
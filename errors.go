@@ -0,0 +1,27 @@
+package filemutex
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrNotSupported indicates that the underlying filesystem does not support
+// advisory file locking, as some NFS configurations don't.
+var ErrNotSupported = errors.New("file locking not supported")
+
+// IsNotSupported reports whether err indicates that file locking is not
+// supported by the underlying filesystem, so callers can fall back to
+// another coordination mechanism.
+func IsNotSupported(err error) bool {
+	return errors.Is(err, ErrNotSupported)
+}
+
+// wrapPathErr wraps err as a *fs.PathError carrying op and path, matching
+// the convention the os package uses for filesystem errors, so callers can
+// unwrap it with errors.As for diagnostics.
+func wrapPathErr(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,270 @@
+package filemutex
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// staleTicketTimeout bounds how long FairFileMutex waits for now_serving to
+// advance before assuming the holder ahead of it crashed without releasing
+// its ticket, and forcibly advancing past it.
+const staleTicketTimeout = 30 * time.Second
+
+// FairFileMutex is a FileMutex variant that hands out locks in the order
+// waiters arrived, using a ticket-queue sidecar file to avoid the
+// starvation that raw flock/LockFileEx allow under heavy contention. It
+// trades a small amount of throughput for bounded wait time; use New for the
+// default, unfair, lower-overhead lock.
+type FairFileMutex struct {
+	main        *FileMutex
+	sidecarPath string
+	sidecarLock *FileMutex
+}
+
+// NewFair opens filename for fair locking, alongside a sidecar file
+// (filename+".ticket") used to track lock ordering.
+func NewFair(filename string) (*FairFileMutex, error) {
+	main, err := New(filename)
+	if err != nil {
+		return nil, err
+	}
+	sidecarPath := filename + ".ticket"
+	sidecarLock, err := New(sidecarPath)
+	if err != nil {
+		main.Close()
+		return nil, err
+	}
+	return &FairFileMutex{main: main, sidecarPath: sidecarPath, sidecarLock: sidecarLock}, nil
+}
+
+// ticketCounters is the sidecar file's content: three 8-byte big-endian
+// counters tracking ticket order and in-flight readers.
+type ticketCounters struct {
+	nextTicket      uint64
+	nowServing      uint64
+	readersInFlight uint64
+}
+
+func (m *FairFileMutex) readCounters() (ticketCounters, error) {
+	data, err := ioutil.ReadFile(m.sidecarPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ticketCounters{}, nil
+		}
+		return ticketCounters{}, err
+	}
+	if len(data) < 24 {
+		return ticketCounters{}, nil
+	}
+	return ticketCounters{
+		nextTicket:      binary.BigEndian.Uint64(data[0:8]),
+		nowServing:      binary.BigEndian.Uint64(data[8:16]),
+		readersInFlight: binary.BigEndian.Uint64(data[16:24]),
+	}, nil
+}
+
+func (m *FairFileMutex) writeCounters(c ticketCounters) error {
+	buf := make([]byte, 24)
+	binary.BigEndian.PutUint64(buf[0:8], c.nextTicket)
+	binary.BigEndian.PutUint64(buf[8:16], c.nowServing)
+	binary.BigEndian.PutUint64(buf[16:24], c.readersInFlight)
+	return ioutil.WriteFile(m.sidecarPath, buf, 0666)
+}
+
+// takeTicket atomically reads and increments next_ticket, returning the
+// ticket the caller was assigned.
+func (m *FairFileMutex) takeTicket() (uint64, error) {
+	if err := m.sidecarLock.Lock(); err != nil {
+		return 0, err
+	}
+	defer m.sidecarLock.Unlock()
+	c, err := m.readCounters()
+	if err != nil {
+		return 0, err
+	}
+	ticket := c.nextTicket
+	c.nextTicket++
+	return ticket, m.writeCounters(c)
+}
+
+// waitForTurn blocks until now_serving reaches ticket. If now_serving has
+// not advanced for longer than staleTicketTimeout, the holder ahead of us is
+// assumed to have crashed while holding its ticket, and we advance past it.
+func (m *FairFileMutex) waitForTurn(ctx context.Context, ticket uint64) error {
+	backoff := time.Millisecond
+	const maxBackoff = 100 * time.Millisecond
+	var lastServing uint64
+	var lastProgress time.Time
+	for {
+		c, err := m.peekCounters()
+		if err != nil {
+			return err
+		}
+		if c.nowServing == ticket {
+			return nil
+		}
+		if c.nowServing != lastServing {
+			lastServing = c.nowServing
+			lastProgress = time.Time{}
+		} else if lastProgress.IsZero() {
+			lastProgress = time.Now()
+		} else if time.Now().Sub(lastProgress) > staleTicketTimeout {
+			if err := m.advancePast(c.nowServing); err != nil {
+				return err
+			}
+			lastProgress = time.Time{}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+func (m *FairFileMutex) peekCounters() (ticketCounters, error) {
+	if err := m.sidecarLock.Lock(); err != nil {
+		return ticketCounters{}, err
+	}
+	defer m.sidecarLock.Unlock()
+	return m.readCounters()
+}
+
+// advancePast bumps now_serving past a ticket whose holder is believed to
+// have crashed, but only if now_serving still matches what we last observed
+// (another waiter may have already recovered it).
+func (m *FairFileMutex) advancePast(serving uint64) error {
+	if err := m.sidecarLock.Lock(); err != nil {
+		return err
+	}
+	defer m.sidecarLock.Unlock()
+	c, err := m.readCounters()
+	if err != nil {
+		return err
+	}
+	if c.nowServing != serving {
+		return nil
+	}
+	c.nowServing++
+	return m.writeCounters(c)
+}
+
+func (m *FairFileMutex) advanceServing() error {
+	if err := m.sidecarLock.Lock(); err != nil {
+		return err
+	}
+	defer m.sidecarLock.Unlock()
+	c, err := m.readCounters()
+	if err != nil {
+		return err
+	}
+	c.nowServing++
+	return m.writeCounters(c)
+}
+
+// Lock acquires the lock in ticket order, blocking until it is this caller's
+// turn and the underlying lock is free.
+func (m *FairFileMutex) Lock() error {
+	return m.LockContext(context.Background())
+}
+
+// LockContext is like Lock, but returns ctx.Err() if ctx is done first.
+func (m *FairFileMutex) LockContext(ctx context.Context) error {
+	ticket, err := m.takeTicket()
+	if err != nil {
+		return err
+	}
+	if err := m.waitForTurn(ctx, ticket); err != nil {
+		return err
+	}
+	if err := m.main.LockContext(ctx); err != nil {
+		m.advanceServing()
+		return err
+	}
+	return nil
+}
+
+// Unlock releases the lock and advances the ticket queue.
+func (m *FairFileMutex) Unlock() error {
+	err := m.main.Unlock()
+	if advErr := m.advanceServing(); err == nil {
+		err = advErr
+	}
+	return err
+}
+
+// RLock acquires a shared lock in ticket order. Contiguous readers coalesce:
+// once the first reader in line is granted, readers_in_flight is
+// incremented and the next ticket is served immediately rather than waiting
+// for the reader to release.
+func (m *FairFileMutex) RLock() error {
+	return m.RLockContext(context.Background())
+}
+
+// RLockContext is like RLock, but returns ctx.Err() if ctx is done first.
+func (m *FairFileMutex) RLockContext(ctx context.Context) error {
+	ticket, err := m.takeTicket()
+	if err != nil {
+		return err
+	}
+	if err := m.waitForTurn(ctx, ticket); err != nil {
+		return err
+	}
+	if err := m.main.RLockContext(ctx); err != nil {
+		m.advanceServing()
+		return err
+	}
+	if err := m.sidecarLock.Lock(); err != nil {
+		return err
+	}
+	defer m.sidecarLock.Unlock()
+	c, err := m.readCounters()
+	if err != nil {
+		return err
+	}
+	c.readersInFlight++
+	c.nowServing++
+	return m.writeCounters(c)
+}
+
+// RUnlock releases a shared lock taken with RLock.
+func (m *FairFileMutex) RUnlock() error {
+	err := m.main.RUnlock()
+	if lockErr := m.sidecarLock.Lock(); lockErr != nil {
+		if err == nil {
+			err = lockErr
+		}
+		return err
+	}
+	defer m.sidecarLock.Unlock()
+	c, cErr := m.readCounters()
+	if cErr != nil {
+		if err == nil {
+			err = cErr
+		}
+		return err
+	}
+	if c.readersInFlight > 0 {
+		c.readersInFlight--
+	}
+	if wErr := m.writeCounters(c); wErr != nil && err == nil {
+		err = wErr
+	}
+	return err
+}
+
+// Close releases the sidecar and main file handles.
+func (m *FairFileMutex) Close() error {
+	err := m.main.Close()
+	if sErr := m.sidecarLock.Close(); sErr != nil && err == nil {
+		err = sErr
+	}
+	return err
+}
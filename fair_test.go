@@ -0,0 +1,101 @@
+package filemutex
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFairFileMutexLockUnlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fair")
+	m, err := NewFair(path)
+	if err != nil {
+		t.Fatalf("NewFair: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := m.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
+
+func TestFairFileMutexOrdersWaiters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fair")
+	m1, err := NewFair(path)
+	if err != nil {
+		t.Fatalf("NewFair: %v", err)
+	}
+	defer m1.Close()
+
+	if err := m1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	m2, err := NewFair(path)
+	if err != nil {
+		t.Fatalf("NewFair: %v", err)
+	}
+	defer m2.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m2.Lock()
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("second Lock returned before the first Unlock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := m1.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("second Lock: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("second Lock never completed after first Unlock")
+	}
+	m2.Unlock()
+}
+
+func TestFairFileMutexRLockCoalesces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fair-read")
+	m1, err := NewFair(path)
+	if err != nil {
+		t.Fatalf("NewFair: %v", err)
+	}
+	defer m1.Close()
+	m2, err := NewFair(path)
+	if err != nil {
+		t.Fatalf("NewFair: %v", err)
+	}
+	defer m2.Close()
+
+	if err := m1.RLock(); err != nil {
+		t.Fatalf("RLock m1: %v", err)
+	}
+	defer m1.RUnlock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m2.RLock()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RLock m2: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("concurrent readers should not block each other")
+	}
+	m2.RUnlock()
+}
@@ -0,0 +1,8 @@
+// Package filemutex provides an interprocess mutex backed by file locking.
+package filemutex
+
+import "errors"
+
+// AlreadyLocked is returned by TryLock and TryRLock when the lock is already
+// held by another holder.
+var AlreadyLocked = errors.New("already locked")
@@ -0,0 +1,103 @@
+//go:build aix || solaris
+
+package filemutex
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// FileMutex on AIX and Solaris is backed by fcntl byte-range locks over the
+// whole file, since those platforms lack BSD flock.
+type FileMutex struct {
+	fd        int
+	path      string
+	inproc    *inProcessEntry
+	inprocKey string
+}
+
+func New(filename string) (*FileMutex, error) {
+	return NewWithPermission(filename, 0666)
+}
+
+func NewWithPermission(filename string, perm uint32) (*FileMutex, error) {
+	fd, err := syscall.Open(filename, syscall.O_CREAT|syscall.O_RDWR, perm)
+	if err != nil {
+		return nil, wrapPathErr("open", filename, err)
+	}
+	entry, key, err := acquireInProcessEntry(filename)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &FileMutex{fd: fd, path: filename, inproc: entry, inprocKey: key}, nil
+}
+
+func wholeFileLock(typ int16) syscall.Flock_t {
+	return syscall.Flock_t{Type: typ, Whence: 0, Start: 0, Len: 0}
+}
+
+func (m *FileMutex) lock(typ int16, cmd int) error {
+	lk := wholeFileLock(typ)
+	err := syscall.FcntlFlock(uintptr(m.fd), cmd, &lk)
+	if err == nil {
+		return nil
+	}
+	if cmd == syscall.F_SETLK && (err == syscall.EACCES || err == syscall.EAGAIN) {
+		return AlreadyLocked
+	}
+	if err == syscall.ENOLCK || err == syscall.EOPNOTSUPP {
+		return wrapPathErr("fcntl", m.path, ErrNotSupported)
+	}
+	return wrapPathErr("fcntl", m.path, err)
+}
+
+func (m *FileMutex) lockOS() error     { return m.lock(syscall.F_WRLCK, syscall.F_SETLKW) }
+func (m *FileMutex) rLockOS() error    { return m.lock(syscall.F_RDLCK, syscall.F_SETLKW) }
+func (m *FileMutex) tryLockOS() error  { return m.lock(syscall.F_WRLCK, syscall.F_SETLK) }
+func (m *FileMutex) tryRLockOS() error { return m.lock(syscall.F_RDLCK, syscall.F_SETLK) }
+
+func (m *FileMutex) unlockOS() error {
+	lk := wholeFileLock(syscall.F_UNLCK)
+	return wrapPathErr("fcntl", m.path, syscall.FcntlFlock(uintptr(m.fd), syscall.F_SETLK, &lk))
+}
+
+func (m *FileMutex) rUnlockOS() error { return m.unlockOS() }
+
+func (m *FileMutex) closeOS() error {
+	m.unlockOS()
+	err := wrapPathErr("close", m.path, syscall.Close(m.fd))
+	releaseInProcessEntry(m.inprocKey)
+	return err
+}
+
+// pollOS polls try (tryLockOS or tryRLockOS) with exponential backoff until
+// it succeeds or ctx is done, since fcntl's F_SETLK has no way to wait on a
+// channel either.
+func pollOS(ctx context.Context, try func() error) error {
+	backoff := time.Millisecond
+	const maxBackoff = 100 * time.Millisecond
+	for {
+		err := try()
+		if err != AlreadyLocked {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+func (m *FileMutex) lockOSContext(ctx context.Context) error {
+	return pollOS(ctx, m.tryLockOS)
+}
+
+func (m *FileMutex) rLockOSContext(ctx context.Context) error {
+	return pollOS(ctx, m.tryRLockOS)
+}
@@ -0,0 +1,125 @@
+//go:build plan9
+
+package filemutex
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// FileMutex on Plan 9 has no flock/fcntl equivalent, so it locks via the
+// ModeExclusive bit that Go's cmd/go/internal/lockedfile also relies on: a
+// file created with that bit set can only be open once at a time
+// system-wide, so opening it for read-write doubles as taking the lock.
+type FileMutex struct {
+	path      string
+	f         *os.File
+	inproc    *inProcessEntry
+	inprocKey string
+}
+
+func New(filename string) (*FileMutex, error) {
+	return NewWithPermission(filename, 0666)
+}
+
+func NewWithPermission(filename string, perm uint32) (*FileMutex, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE, os.FileMode(perm)|os.ModeExclusive)
+	if err != nil {
+		return nil, wrapPathErr("open", filename, err)
+	}
+	f.Close()
+	entry, key, err := acquireInProcessEntry(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMutex{path: filename, inproc: entry, inprocKey: key}, nil
+}
+
+func (m *FileMutex) open() error {
+	f, err := os.OpenFile(m.path, os.O_RDWR, os.ModeExclusive)
+	if err != nil {
+		return err
+	}
+	m.f = f
+	return nil
+}
+
+func (m *FileMutex) lockOS() error {
+	backoff := time.Millisecond
+	const maxBackoff = 100 * time.Millisecond
+	for {
+		err := m.open()
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) {
+			return wrapPathErr("open", m.path, err)
+		}
+		time.Sleep(backoff)
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+func (m *FileMutex) tryLockOS() error {
+	if err := m.open(); err != nil {
+		if os.IsExist(err) {
+			return AlreadyLocked
+		}
+		return wrapPathErr("open", m.path, err)
+	}
+	return nil
+}
+
+// rLockOS, tryRLockOS and rUnlockOS alias the exclusive variants: Plan 9's
+// ModeExclusive has no separate shared-lock mode.
+func (m *FileMutex) rLockOS() error    { return m.lockOS() }
+func (m *FileMutex) tryRLockOS() error { return m.tryLockOS() }
+func (m *FileMutex) rUnlockOS() error  { return m.unlockOS() }
+
+func (m *FileMutex) unlockOS() error {
+	if m.f == nil {
+		return nil
+	}
+	err := m.f.Close()
+	m.f = nil
+	return wrapPathErr("close", m.path, err)
+}
+
+func (m *FileMutex) closeOS() error {
+	err := m.unlockOS()
+	releaseInProcessEntry(m.inprocKey)
+	return err
+}
+
+// pollOS polls try (tryLockOS or tryRLockOS) with exponential backoff until
+// it succeeds or ctx is done, since ModeExclusive open has no way to wait on
+// a channel either.
+func pollOS(ctx context.Context, try func() error) error {
+	backoff := time.Millisecond
+	const maxBackoff = 100 * time.Millisecond
+	for {
+		err := try()
+		if err != AlreadyLocked {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+func (m *FileMutex) lockOSContext(ctx context.Context) error {
+	return pollOS(ctx, m.tryLockOS)
+}
+
+func (m *FileMutex) rLockOSContext(ctx context.Context) error {
+	return pollOS(ctx, m.tryRLockOS)
+}
@@ -0,0 +1,130 @@
+package filemutex
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockUnlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	m, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if err := m.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
+
+func TestTryLockAlreadyLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	m1, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m1.Close()
+	m2, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m2.Close()
+
+	if err := m1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer m1.Unlock()
+
+	if err := m2.TryLock(); err != AlreadyLocked {
+		t.Fatalf("TryLock = %v, want AlreadyLocked", err)
+	}
+}
+
+func TestLockContextTimesOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	m1, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m1.Close()
+	m2, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m2.Close()
+
+	if err := m1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer m1.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m2.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("LockContext = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestTryLockForTimesOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	m1, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m1.Close()
+	m2, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m2.Close()
+
+	if err := m1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer m1.Unlock()
+
+	if err := m2.TryLockFor(50 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("TryLockFor = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestLockContextSucceedsOnceReleased(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	m1, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m1.Close()
+	m2, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m2.Close()
+
+	if err := m1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	done := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go func() {
+		done <- m2.LockContext(ctx)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := m1.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("LockContext = %v, want nil", err)
+	}
+	m2.Unlock()
+}
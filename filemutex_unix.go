@@ -0,0 +1,171 @@
+//go:build !windows && !solaris && !aix && !plan9
+
+package filemutex
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// FileMutex is similar to sync.RWMutex, but also synchronizes across processes.
+// This implementation is based on flock syscall.
+type FileMutex struct {
+	fd        int
+	path      string
+	inproc    *inProcessEntry
+	inprocKey string
+}
+
+func New(filename string) (*FileMutex, error) {
+	return NewWithPermission(filename, 0666)
+}
+
+func NewWithPermission(filename string, perm uint32) (*FileMutex, error) {
+	fd, err := syscall.Open(filename, syscall.O_CREAT|syscall.O_RDWR, perm)
+	if err != nil {
+		return nil, wrapPathErr("open", filename, err)
+	}
+	entry, key, err := acquireInProcessEntry(filename)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &FileMutex{fd: fd, path: filename, inproc: entry, inprocKey: key}, nil
+}
+
+// mapUnsupported translates the errnos filesystems (commonly some NFS
+// configurations) return when they reject advisory locking into
+// ErrNotSupported, so callers can detect it with IsNotSupported.
+func mapUnsupported(err error) error {
+	switch err {
+	case syscall.ENOLCK, syscall.EOPNOTSUPP:
+		return ErrNotSupported
+	default:
+		return err
+	}
+}
+
+func (m *FileMutex) lockOS() error {
+	return wrapPathErr("flock", m.path, mapUnsupported(syscall.Flock(m.fd, syscall.LOCK_EX)))
+}
+
+func (m *FileMutex) tryLockOS() error {
+	err := syscall.Flock(m.fd, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return AlreadyLocked
+	}
+	return wrapPathErr("flock", m.path, mapUnsupported(err))
+}
+
+func (m *FileMutex) rLockOS() error {
+	return wrapPathErr("flock", m.path, mapUnsupported(syscall.Flock(m.fd, syscall.LOCK_SH)))
+}
+
+func (m *FileMutex) tryRLockOS() error {
+	err := syscall.Flock(m.fd, syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return AlreadyLocked
+	}
+	return wrapPathErr("flock", m.path, mapUnsupported(err))
+}
+
+// pollFlock polls flock with exponential backoff until it succeeds, ctx is
+// done, or it fails for a reason other than contention. flock has no native
+// way to wait on a channel, so this is the closest cancellable equivalent.
+func (m *FileMutex) pollFlock(ctx context.Context, how int) error {
+	backoff := time.Millisecond
+	const maxBackoff = 100 * time.Millisecond
+	for {
+		err := syscall.Flock(m.fd, how|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+func (m *FileMutex) lockOSContext(ctx context.Context) error {
+	return m.pollFlock(ctx, syscall.LOCK_EX)
+}
+
+func (m *FileMutex) rLockOSContext(ctx context.Context) error {
+	return m.pollFlock(ctx, syscall.LOCK_SH)
+}
+
+// whenceStart is syscall.Flock_t.Whence for SEEK_SET, spelled out to avoid
+// pulling in the io package for a single constant.
+const whenceStart = 0
+
+func rangeLock(typ int16, offset, length int64) syscall.Flock_t {
+	return syscall.Flock_t{Type: typ, Whence: whenceStart, Start: offset, Len: length}
+}
+
+// LockRange locks the byte range [offset, offset+length) of the underlying
+// file, exclusively or for shared reading, blocking until it is granted.
+// Unlike Lock/RLock, which lock the whole file, this lets callers partition a
+// file into independently lockable regions.
+//
+// On Unix this is backed by fcntl byte-range locks, which are a separate
+// lock table from the flock locks Lock/RLock use (see flock(2): "flock()
+// does not interact with fcntl(2) locks"). The two do not exclude each
+// other: holding Lock() on a FileMutex does not block a LockRange() call on
+// the same path, even from a different FileMutex. Use one API or the other
+// for a given path, not both.
+func (m *FileMutex) LockRange(offset, length int64, exclusive bool) error {
+	typ := int16(syscall.F_RDLCK)
+	if exclusive {
+		typ = syscall.F_WRLCK
+	}
+	lk := rangeLock(typ, offset, length)
+	err := syscall.FcntlFlock(uintptr(m.fd), syscall.F_SETLKW, &lk)
+	return wrapPathErr("fcntl", m.path, mapUnsupported(err))
+}
+
+// TryLockRange is like LockRange, but returns AlreadyLocked instead of
+// blocking if the range is already locked by another holder.
+func (m *FileMutex) TryLockRange(offset, length int64, exclusive bool) error {
+	typ := int16(syscall.F_RDLCK)
+	if exclusive {
+		typ = syscall.F_WRLCK
+	}
+	lk := rangeLock(typ, offset, length)
+	err := syscall.FcntlFlock(uintptr(m.fd), syscall.F_SETLK, &lk)
+	if err == syscall.EACCES || err == syscall.EAGAIN {
+		return AlreadyLocked
+	}
+	return wrapPathErr("fcntl", m.path, mapUnsupported(err))
+}
+
+// UnlockRange releases a lock previously taken with LockRange or
+// TryLockRange on the same byte range.
+func (m *FileMutex) UnlockRange(offset, length int64) error {
+	lk := rangeLock(syscall.F_UNLCK, offset, length)
+	err := syscall.FcntlFlock(uintptr(m.fd), syscall.F_SETLK, &lk)
+	return wrapPathErr("fcntl", m.path, err)
+}
+
+func (m *FileMutex) rUnlockOS() error {
+	return wrapPathErr("flock", m.path, syscall.Flock(m.fd, syscall.LOCK_UN))
+}
+
+func (m *FileMutex) unlockOS() error {
+	return wrapPathErr("flock", m.path, syscall.Flock(m.fd, syscall.LOCK_UN))
+}
+
+func (m *FileMutex) closeOS() error {
+	m.unlockOS()
+	err := wrapPathErr("close", m.path, syscall.Close(m.fd))
+	releaseInProcessEntry(m.inprocKey)
+	return err
+}
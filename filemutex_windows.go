@@ -5,6 +5,7 @@
 package filemutex
 
 import (
+	"context"
 	"syscall"
 	"unsafe"
 )
@@ -13,6 +14,7 @@ var (
 	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
 	procLockFileEx   = modkernel32.NewProc("LockFileEx")
 	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+	procCancelIoEx   = modkernel32.NewProc("CancelIoEx")
 )
 
 const (
@@ -44,19 +46,39 @@ func unlockFileEx(h syscall.Handle, reserved, locklow, lockhigh uint32, ol *sysc
 	return
 }
 
+func cancelIoEx(h syscall.Handle, ol *syscall.Overlapped) (err error) {
+	r1, _, e1 := syscall.Syscall(procCancelIoEx.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(ol)), 0)
+	if r1 == 0 {
+		if e1 != 0 {
+			err = error(e1)
+		} else {
+			err = syscall.EINVAL
+		}
+	}
+	return
+}
+
 // FileMutex is similar to sync.RWMutex, but also synchronizes across processes.
 // This implementation is based on flock syscall.
 type FileMutex struct {
-	fd syscall.Handle
+	fd        syscall.Handle
+	path      string
+	inproc    *inProcessEntry
+	inprocKey string
 }
 
 func New(filename string) (*FileMutex, error) {
 	fd, err := syscall.CreateFile(&(syscall.StringToUTF16(filename)[0]), syscall.GENERIC_READ|syscall.GENERIC_WRITE,
 		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
 	if err != nil {
+		return nil, wrapPathErr("CreateFile", filename, err)
+	}
+	entry, key, err := acquireInProcessEntry(filename)
+	if err != nil {
+		syscall.Close(fd)
 		return nil, err
 	}
-	return &FileMutex{fd: fd}, nil
+	return &FileMutex{fd: fd, path: filename, inproc: entry, inprocKey: key}, nil
 }
 
 func NewWithPermission(filename string, perm uint32) (*FileMutex, error) {
@@ -64,7 +86,16 @@ func NewWithPermission(filename string, perm uint32) (*FileMutex, error) {
 	return New(filename)
 }
 
-func (m *FileMutex) TryLock() error {
+// mapUnsupported translates ERROR_NOT_SUPPORTED into ErrNotSupported, so
+// callers can detect it with IsNotSupported.
+func mapUnsupported(err error) error {
+	if errno, ok := err.(syscall.Errno); ok && errno == syscall.Errno(50) { // ERROR_NOT_SUPPORTED
+		return ErrNotSupported
+	}
+	return err
+}
+
+func (m *FileMutex) tryLockOS() error {
 	var ol syscall.Overlapped
 	if err := lockFileEx(m.fd, lockfileFailImmediately|lockfileExclusiveLock, 0, 1, 0, &ol); err != nil {
 		if errno, ok := err.(syscall.Errno); ok {
@@ -72,48 +103,133 @@ func (m *FileMutex) TryLock() error {
 				return AlreadyLocked
 			}
 		}
-		return err
+		return wrapPathErr("LockFileEx", m.path, mapUnsupported(err))
 	}
 	return nil
 }
 
-func (m *FileMutex) Lock() error {
+func (m *FileMutex) lockOS() error {
 	var ol syscall.Overlapped
 	if err := lockFileEx(m.fd, lockfileExclusiveLock, 0, 1, 0, &ol); err != nil {
-		return err
+		return wrapPathErr("LockFileEx", m.path, mapUnsupported(err))
 	}
 	return nil
 }
 
-func (m *FileMutex) Unlock() error {
+func (m *FileMutex) unlockOS() error {
 	var ol syscall.Overlapped
 	if err := unlockFileEx(m.fd, 0, 1, 0, &ol); err != nil {
-		return err
+		return wrapPathErr("UnlockFileEx", m.path, err)
 	}
 	return nil
 }
 
-func (m *FileMutex) RLock() error {
+func (m *FileMutex) rLockOS() error {
 	var ol syscall.Overlapped
 	if err := lockFileEx(m.fd, 0, 0, 1, 0, &ol); err != nil {
-		return err
+		return wrapPathErr("LockFileEx", m.path, mapUnsupported(err))
+	}
+	return nil
+}
+
+func (m *FileMutex) tryRLockOS() error {
+	var ol syscall.Overlapped
+	if err := lockFileEx(m.fd, lockfileFailImmediately, 0, 1, 0, &ol); err != nil {
+		if errno, ok := err.(syscall.Errno); ok {
+			if errno == syscall.Errno(0x21) {
+				return AlreadyLocked
+			}
+		}
+		return wrapPathErr("LockFileEx", m.path, mapUnsupported(err))
 	}
 	return nil
 }
 
-func (m *FileMutex) RUnlock() error {
+func (m *FileMutex) rUnlockOS() error {
 	var ol syscall.Overlapped
 	if err := unlockFileEx(m.fd, 0, 1, 0, &ol); err != nil {
+		return wrapPathErr("UnlockFileEx", m.path, err)
+	}
+	return nil
+}
+
+// asyncLockFileEx starts LockFileEx on its own goroutine, since the syscall
+// blocks until the lock is granted and the Go scheduler cannot preempt it.
+// If ctx is done first, CancelIoEx aborts the pending I/O so the goroutine
+// can return.
+func (m *FileMutex) asyncLockFileEx(ctx context.Context, flags uint32) error {
+	var ol syscall.Overlapped
+	done := make(chan error, 1)
+	go func() {
+		done <- lockFileEx(m.fd, flags, 0, 1, 0, &ol)
+	}()
+	select {
+	case err := <-done:
 		return err
+	case <-ctx.Done():
+		if err := cancelIoEx(m.fd, &ol); err != nil {
+			return err
+		}
+		<-done // wait for the goroutine above to observe the cancellation
+		return ctx.Err()
+	}
+}
+
+func (m *FileMutex) lockOSContext(ctx context.Context) error {
+	return m.asyncLockFileEx(ctx, lockfileExclusiveLock)
+}
+
+func (m *FileMutex) rLockOSContext(ctx context.Context) error {
+	return m.asyncLockFileEx(ctx, 0)
+}
+
+// LockRange locks the byte range [offset, offset+length) of the underlying
+// file, exclusively or for shared reading, blocking until it is granted.
+// Unlike Lock/RLock, which always hold byte 0, this lets callers partition a
+// file into independently lockable regions.
+func (m *FileMutex) LockRange(offset, length int64, exclusive bool) error {
+	ol := syscall.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	flags := uint32(0)
+	if exclusive {
+		flags = lockfileExclusiveLock
+	}
+	err := lockFileEx(m.fd, flags, 0, uint32(length), uint32(length>>32), &ol)
+	return wrapPathErr("LockFileEx", m.path, mapUnsupported(err))
+}
+
+// TryLockRange is like LockRange, but returns AlreadyLocked instead of
+// blocking if the range is already locked by another holder.
+func (m *FileMutex) TryLockRange(offset, length int64, exclusive bool) error {
+	ol := syscall.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	flags := uint32(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	if err := lockFileEx(m.fd, flags, 0, uint32(length), uint32(length>>32), &ol); err != nil {
+		if errno, ok := err.(syscall.Errno); ok {
+			if errno == syscall.Errno(0x21) {
+				return AlreadyLocked
+			}
+		}
+		return wrapPathErr("LockFileEx", m.path, mapUnsupported(err))
 	}
 	return nil
 }
 
-// Close unlocks the lock and closes the underlying file descriptor.
-func (m *FileMutex) Close() error {
+// UnlockRange releases a lock previously taken with LockRange or
+// TryLockRange on the same byte range.
+func (m *FileMutex) UnlockRange(offset, length int64) error {
+	ol := syscall.Overlapped{Offset: uint32(offset), OffsetHigh: uint32(offset >> 32)}
+	err := unlockFileEx(m.fd, 0, uint32(length), uint32(length>>32), &ol)
+	return wrapPathErr("UnlockFileEx", m.path, err)
+}
+
+func (m *FileMutex) closeOS() error {
 	var ol syscall.Overlapped
 	if err := unlockFileEx(m.fd, 0, 1, 0, &ol); err != nil {
-		return err
+		return wrapPathErr("UnlockFileEx", m.path, err)
 	}
-	return syscall.Close(m.fd)
+	err := wrapPathErr("close", m.path, syscall.Close(m.fd))
+	releaseInProcessEntry(m.inprocKey)
+	return err
 }
@@ -0,0 +1,111 @@
+package filemutex
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	want := []byte("hello world")
+	if err := Write(path, want, 0644); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Read = %q, want %q", got, want)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	for i := 0; i < 3; i++ {
+		err := Edit(path, func(data []byte) ([]byte, error) {
+			n := 0
+			if len(data) > 0 {
+				n = int(data[0])
+			}
+			return []byte{byte(n + 1)}, nil
+		})
+		if err != nil {
+			t.Fatalf("Edit: %v", err)
+		}
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != 1 || got[0] != 3 {
+		t.Fatalf("final value = %v, want [3]", got)
+	}
+}
+
+func TestOpenFileClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openfile")
+	f, err := OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if _, err := f.Write([]byte("abc")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// TestEditConcurrentAppendsAllSurvive is a regression test for the
+// rename-under-lock bug: Edit used to write through a temp-file-plus-rename,
+// which swaps the path to a new inode while the lock is still held on the
+// old one, letting concurrent callers race past each other's locks. Every
+// concurrent append below must survive.
+func TestEditConcurrentAppendsAllSurvive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appends")
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			if err := Edit(path, func(data []byte) ([]byte, error) {
+				return append(append([]byte{}, data...), id), nil
+			}); err != nil {
+				t.Errorf("Edit: %v", err)
+			}
+		}(byte(i))
+	}
+	wg.Wait()
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != n {
+		t.Fatalf("final length = %d, want %d (lost updates)", len(got), n)
+	}
+}
+
+func TestOpenFileSharedRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared")
+	if err := Write(path, []byte("xyz"), 0644); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	r1, err := OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile r1: %v", err)
+	}
+	defer r1.Close()
+
+	r2, err := OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile r2 should be able to share a read lock with r1: %v", err)
+	}
+	r2.Close()
+}
@@ -0,0 +1,17 @@
+package filemutex
+
+// Locker is the stable, platform-independent interface implemented by
+// FileMutex on every supported OS. Code that only needs Lock/Unlock
+// semantics should depend on Locker rather than *FileMutex directly, so it
+// keeps working if a platform ever needs a different concrete type.
+type Locker interface {
+	Lock() error
+	TryLock() error
+	RLock() error
+	TryRLock() error
+	Unlock() error
+	RUnlock() error
+	Close() error
+}
+
+var _ Locker = (*FileMutex)(nil)
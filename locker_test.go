@@ -0,0 +1,36 @@
+package filemutex
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileMutexImplementsLocker(t *testing.T) {
+	var _ Locker = (*FileMutex)(nil)
+}
+
+func TestIsNotSupported(t *testing.T) {
+	if !IsNotSupported(ErrNotSupported) {
+		t.Fatalf("IsNotSupported(ErrNotSupported) = false, want true")
+	}
+	if IsNotSupported(errors.New("some other error")) {
+		t.Fatalf("IsNotSupported(other) = true, want false")
+	}
+}
+
+func TestLockErrorIsPathError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing-dir", "lock")
+	_, err := New(path)
+	if err == nil {
+		t.Fatalf("New succeeded for a path in a nonexistent directory")
+	}
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("New error = %v (%T), want *fs.PathError", err, err)
+	}
+	if pathErr.Path != path {
+		t.Fatalf("PathError.Path = %q, want %q", pathErr.Path, path)
+	}
+}
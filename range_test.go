@@ -0,0 +1,49 @@
+//go:build !solaris && !aix && !plan9
+
+package filemutex
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestLockRangeWriteLock is a regression test for the O_RDONLY bug: New
+// opened the lock fd read-only, so an exclusive (write) range lock failed
+// with EBADF from fcntl/LockFileEx before ever reaching the real locking
+// logic.
+func TestLockRangeWriteLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranged")
+	m, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.LockRange(0, 10, true); err != nil {
+		t.Fatalf("LockRange(0, 10, true): %v", err)
+	}
+	if err := m.UnlockRange(0, 10); err != nil {
+		t.Fatalf("UnlockRange(0, 10): %v", err)
+	}
+}
+
+func TestLockRangeDisjointRegions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranged")
+	m, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.LockRange(0, 10, true); err != nil {
+		t.Fatalf("LockRange(0, 10, true): %v", err)
+	}
+	defer m.UnlockRange(0, 10)
+
+	if err := m.TryLockRange(20, 10, true); err != nil {
+		t.Fatalf("TryLockRange(20, 10, true) on a disjoint range: %v", err)
+	}
+	if err := m.UnlockRange(20, 10); err != nil {
+		t.Fatalf("UnlockRange(20, 10): %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !windows && !solaris && !aix && !plan9
+
+package filemutex
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestLockRangeIndependentOfWholeFileLock pins down a real POSIX limitation
+// documented on LockRange: flock (Lock/RLock) and fcntl byte-range locks
+// (LockRange/TryLockRange/UnlockRange) are independent lock tables on Unix
+// and do not see each other. If a future change to either backend made them
+// start (or silently stop) interacting, this test would catch it.
+func TestLockRangeIndependentOfWholeFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mixed")
+	m1, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m1.Close()
+	if err := m1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer m1.Unlock()
+
+	m2, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m2.Close()
+
+	// flock and fcntl locks don't interact on Unix, so this succeeds even
+	// though m1 holds an exclusive whole-file flock.
+	if err := m2.TryLockRange(0, 1, true); err != nil {
+		t.Fatalf("TryLockRange while m1 holds Lock() = %v, want nil (flock/fcntl are independent on Unix)", err)
+	}
+	m2.UnlockRange(0, 1)
+}
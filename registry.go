@@ -0,0 +1,169 @@
+package filemutex
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// inProcessEntry pairs a registry entry with an in-process RWMutex, so that
+// goroutines in the same process that construct separate *FileMutex values
+// for the same path still serialize correctly instead of relying on
+// platform-dependent OS lock semantics (fcntl locks on AIX and Solaris are
+// per-process and grant both; LockFileEx blocks the second caller forever on
+// Windows, inside a syscall the Go scheduler cannot preempt).
+type inProcessEntry struct {
+	mu       sync.RWMutex
+	refCount int
+	info     os.FileInfo // identity of the opened file, for the os.SameFile check below
+	keys     []string    // every registry key this entry is reachable under, for releaseInProcessEntry
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*inProcessEntry{}
+)
+
+// canonicalPath resolves symlinks and makes path absolute, so that
+// different spellings of the same file (relative vs. absolute, through a
+// symlink or not) map to the same registry entry.
+func canonicalPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		resolved = path
+	}
+	return filepath.Abs(resolved)
+}
+
+// acquireInProcessEntry returns the shared entry for path, creating it if
+// necessary, and registers one more reference to it. Callers must pair this
+// with releaseInProcessEntry when the FileMutex is closed.
+//
+// EvalSymlinks alone doesn't unify every alias for the same file: hardlinks,
+// bind mounts, and ".." traversal into the same inode via a different
+// directory can all produce distinct canonical path strings. So, once the
+// canonical path is computed, this also stats the file and checks it with
+// os.SameFile against every currently registered entry, reusing that entry
+// (under the new key too) on a match instead of creating a duplicate.
+func acquireInProcessEntry(path string) (entry *inProcessEntry, key string, err error) {
+	key, err = canonicalPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	info, statErr := os.Stat(path)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if entry, ok := registry[key]; ok {
+		entry.refCount++
+		return entry, key, nil
+	}
+	if statErr == nil {
+		for _, existing := range registry {
+			if existing.info != nil && os.SameFile(existing.info, info) {
+				existing.refCount++
+				existing.keys = append(existing.keys, key)
+				registry[key] = existing
+				return existing, key, nil
+			}
+		}
+	}
+	entry = &inProcessEntry{info: info, keys: []string{key}}
+	entry.refCount++
+	registry[key] = entry
+	return entry, key, nil
+}
+
+// releaseInProcessEntry drops a reference taken by acquireInProcessEntry,
+// removing the entry from the registry under every key it is reachable
+// under (not just key) once nothing holds it anymore, so aliased paths
+// (hardlinks, bind mounts, ".." traversal) sharing one entry don't leave
+// stale, refCount-0 entries behind under their other keys.
+func releaseInProcessEntry(key string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	entry, ok := registry[key]
+	if !ok {
+		return
+	}
+	entry.refCount--
+	if entry.refCount == 0 {
+		for _, k := range entry.keys {
+			delete(registry, k)
+		}
+	}
+}
+
+// Lock acquires the lock, first in-process (so other goroutines in this
+// process block here rather than racing the OS lock) and then across
+// processes.
+func (m *FileMutex) Lock() error {
+	m.inproc.mu.Lock()
+	if err := m.lockOS(); err != nil {
+		m.inproc.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// TryLock is like Lock, but fails immediately with AlreadyLocked instead of
+// blocking if either the in-process or the OS lock is already held.
+func (m *FileMutex) TryLock() error {
+	if !m.inproc.mu.TryLock() {
+		return AlreadyLocked
+	}
+	if err := m.tryLockOS(); err != nil {
+		m.inproc.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// RLock acquires a shared lock, first in-process and then across processes.
+func (m *FileMutex) RLock() error {
+	m.inproc.mu.RLock()
+	if err := m.rLockOS(); err != nil {
+		m.inproc.mu.RUnlock()
+		return err
+	}
+	return nil
+}
+
+// TryRLock is like RLock, but fails immediately with AlreadyLocked instead
+// of blocking if either the in-process or the OS lock is already held.
+func (m *FileMutex) TryRLock() error {
+	if !m.inproc.mu.TryRLock() {
+		return AlreadyLocked
+	}
+	if err := m.tryRLockOS(); err != nil {
+		m.inproc.mu.RUnlock()
+		return err
+	}
+	return nil
+}
+
+// Unlock releases the lock, across processes first and then in-process, the
+// reverse of the order Lock acquired them in.
+func (m *FileMutex) Unlock() error {
+	err := m.unlockOS()
+	m.inproc.mu.Unlock()
+	return err
+}
+
+// RUnlock releases a shared lock taken with RLock or TryRLock.
+func (m *FileMutex) RUnlock() error {
+	err := m.rUnlockOS()
+	m.inproc.mu.RUnlock()
+	return err
+}
+
+// Close closes the underlying file descriptor and releases this FileMutex's
+// reference to its in-process registry entry. It releases the OS lock but
+// not the in-process lock; call Unlock/RUnlock first.
+func (m *FileMutex) Close() error {
+	return m.closeOS()
+}
@@ -0,0 +1,125 @@
+package filemutex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSameProcessLockSerializes verifies that two *FileMutex values opened
+// on the same path from the same process serialize through the in-process
+// registry, rather than relying on platform-dependent OS lock semantics
+// (fcntl locks on AIX and Solaris are per-process and grant both).
+func TestSameProcessLockSerializes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared")
+	m1, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m1.Close()
+	m2, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m2.Close()
+
+	if err := m1.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	locked := make(chan error, 1)
+	go func() {
+		locked <- m2.Lock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatalf("m2.Lock returned before m1.Unlock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := m1.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatalf("m2.Lock: %v", err)
+		}
+		m2.Unlock()
+	case <-time.After(2 * time.Second):
+		t.Fatalf("m2.Lock never completed")
+	}
+}
+
+// TestAliasedPathsShareRegistryEntry verifies the os.SameFile reconciliation
+// in acquireInProcessEntry: two different path spellings that refer to the
+// same inode via a hardlink must resolve to the same registry entry, not
+// just paths that agree after EvalSymlinks+Abs.
+func TestAliasedPathsShareRegistryEntry(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "original")
+	if err := os.WriteFile(original, nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	alias := filepath.Join(dir, "alias")
+	if err := os.Link(original, alias); err != nil {
+		t.Skipf("hardlinks not supported here: %v", err)
+	}
+
+	e1, k1, err := acquireInProcessEntry(original)
+	if err != nil {
+		t.Fatalf("acquireInProcessEntry(original): %v", err)
+	}
+	defer releaseInProcessEntry(k1)
+
+	e2, k2, err := acquireInProcessEntry(alias)
+	if err != nil {
+		t.Fatalf("acquireInProcessEntry(alias): %v", err)
+	}
+	defer releaseInProcessEntry(k2)
+
+	if e1 != e2 {
+		t.Fatalf("hardlinked paths got different in-process entries")
+	}
+}
+
+// TestReleaseInProcessEntryClearsAllAliasedKeys is a regression test for a
+// registry leak: releasing an aliased entry under one key used to leave it
+// reachable, with refCount 0, under every other key it was registered
+// under. Releasing all references to the entry, in either order, must clear
+// the registry under both keys.
+func TestReleaseInProcessEntryClearsAllAliasedKeys(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "original")
+	if err := os.WriteFile(original, nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	alias := filepath.Join(dir, "alias")
+	if err := os.Link(original, alias); err != nil {
+		t.Skipf("hardlinks not supported here: %v", err)
+	}
+
+	_, k1, err := acquireInProcessEntry(original)
+	if err != nil {
+		t.Fatalf("acquireInProcessEntry(original): %v", err)
+	}
+	_, k2, err := acquireInProcessEntry(alias)
+	if err != nil {
+		t.Fatalf("acquireInProcessEntry(alias): %v", err)
+	}
+
+	releaseInProcessEntry(k1)
+	releaseInProcessEntry(k2)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[k1]; ok {
+		t.Fatalf("registry still has a stale entry under %q after both references were released", k1)
+	}
+	if _, ok := registry[k2]; ok {
+		t.Fatalf("registry still has a stale entry under %q after both references were released", k2)
+	}
+}